@@ -0,0 +1,65 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package rewrite
+
+import (
+	"github.com/xiam/hyperfox/proxy"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+)
+
+/*
+	Returns a Director that searches the (already decoded) response
+	body for pattern and replaces every match with repl.
+*/
+func Body(pattern *regexp.Regexp, repl []byte) proxy.Director {
+	return func(res *http.Response) (io.ReadCloser, error) {
+
+		buf, err := ioutil.ReadAll(res.Body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		buf = pattern.ReplaceAll(buf, repl)
+
+		return ioutil.NopCloser(bytes.NewReader(buf)), nil
+	}
+}
+
+/*
+	Returns a Director that sets header to value on the response,
+	overwriting any previous value.
+*/
+func Header(header, value string) proxy.Director {
+	return func(res *http.Response) (io.ReadCloser, error) {
+		res.Header.Set(header, value)
+		return nil, nil
+	}
+}
+
+/*
+	Returns a Director that removes header from the response.
+*/
+func RemoveHeader(header string) proxy.Director {
+	return func(res *http.Response) (io.ReadCloser, error) {
+		res.Header.Del(header)
+		return nil, nil
+	}
+}
+
+/*
+	Returns a Director that rewrites the response's status code.
+*/
+func Status(code int) proxy.Director {
+	return func(res *http.Response) (io.ReadCloser, error) {
+		res.StatusCode = code
+		return nil, nil
+	}
+}
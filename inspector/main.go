@@ -0,0 +1,149 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package inspector
+
+import (
+	"github.com/xiam/hyperfox/proxy"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	Inspector keeps a live feed of captured transactions and serves a
+	small web UI that lists them in real time, similar to mitmproxy's
+	mitmweb. New transactions are pushed to connected browsers over
+	server-sent events; the UI fetches full bodies from the on-disk
+	archive on demand.
+
+	Implements proxy.EventSink.
+*/
+type Inspector struct {
+	srv  http.Server
+	Bind string
+
+	nextID uint64
+
+	mu          sync.Mutex
+	subscribers map[chan proxy.Event]bool
+}
+
+/*
+	Returns a new Inspector that will listen on addr once Start is
+	called.
+*/
+func New(addr string) *Inspector {
+	return &Inspector{
+		Bind:        addr,
+		subscribers: make(map[chan proxy.Event]bool),
+	}
+}
+
+/*
+	Publish assigns event an ID and fans it out to every connected
+	subscriber. Implements proxy.EventSink.
+*/
+func (self *Inspector) Publish(event proxy.Event) {
+
+	event.ID = atomic.AddUint64(&self.nextID, 1)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for ch := range self.subscribers {
+		select {
+		case ch <- event:
+		default:
+			/* Subscriber is too slow, drop the event rather than block. */
+		}
+	}
+}
+
+func (self *Inspector) subscribe() chan proxy.Event {
+
+	ch := make(chan proxy.Event, 32)
+
+	self.mu.Lock()
+	self.subscribers[ch] = true
+	self.mu.Unlock()
+
+	return ch
+}
+
+func (self *Inspector) unsubscribe(ch chan proxy.Event) {
+	self.mu.Lock()
+	delete(self.subscribers, ch)
+	self.mu.Unlock()
+	close(ch)
+}
+
+/*
+	Streams new transactions to the client as they are captured, using
+	the text/event-stream format.
+*/
+func (self *Inspector) eventsHandler(wri http.ResponseWriter, req *http.Request) {
+
+	flusher, ok := wri.(http.Flusher)
+
+	if !ok {
+		http.Error(wri, "Streaming is not supported.", http.StatusInternalServerError)
+		return
+	}
+
+	wri.Header().Set("Content-Type", "text/event-stream")
+	wri.Header().Set("Cache-Control", "no-cache")
+	wri.Header().Set("Connection", "keep-alive")
+
+	ch := self.subscribe()
+	defer self.unsubscribe(ch)
+
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			buf, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(wri, "data: %s\n\n", buf)
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+/*
+	Serves the inspector's single-page UI.
+*/
+func (self *Inspector) indexHandler(wri http.ResponseWriter, req *http.Request) {
+	wri.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(wri, indexHTML)
+}
+
+/*
+	Starts the inspector's web server. Should usually be run in its own
+	goroutine, e.g. `go insp.Start()`.
+*/
+func (self *Inspector) Start() error {
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", self.indexHandler)
+	mux.HandleFunc("/events", self.eventsHandler)
+	mux.Handle("/archive/", http.StripPrefix("/archive/", http.FileServer(http.Dir(proxy.ArchiveDir))))
+
+	self.srv = http.Server{
+		Addr:    self.Bind,
+		Handler: mux,
+	}
+
+	return self.srv.ListenAndServe()
+}
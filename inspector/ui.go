@@ -0,0 +1,64 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package inspector
+
+/*
+	A minimal single-page UI: a live table of captured transactions
+	fed by /events, with a search box that filters by host, status or
+	content-type and a click handler that pulls the saved body from
+	/archive/<host>/<path>.
+*/
+const indexHTML = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>hyperfox inspector</title>
+	<style>
+		body { font-family: sans-serif; font-size: 13px; }
+		table { border-collapse: collapse; width: 100%; }
+		th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #ddd; }
+		tr:hover { background: #f5f5f5; cursor: pointer; }
+		#filter { width: 100%; padding: 6px; margin-bottom: 8px; }
+	</style>
+</head>
+<body>
+	<input id="filter" placeholder="Filter by host, status or content-type">
+	<table>
+		<thead>
+			<tr><th>#</th><th>Time</th><th>Method</th><th>URL</th><th>Status</th><th>Content-Type</th><th>Size</th></tr>
+		</thead>
+		<tbody id="rows"></tbody>
+	</table>
+	<script>
+		var rows = document.getElementById('rows');
+		var filter = document.getElementById('filter');
+		var events = [];
+
+		function render() {
+			var q = filter.value.toLowerCase();
+			rows.innerHTML = '';
+			events.filter(function (e) {
+				return !q || (e.url + ' ' + e.status + ' ' + e.content_type).toLowerCase().indexOf(q) !== -1;
+			}).forEach(function (e) {
+				var tr = document.createElement('tr');
+				tr.innerHTML = '<td>' + e.id + '</td><td>' + e.time + '</td><td>' + e.method +
+					'</td><td>' + e.url + '</td><td>' + e.status + '</td><td>' + e.content_type + '</td><td>' + e.size + '</td>';
+				tr.onclick = function () { window.open('/archive/' + e.url.replace(/^https?:\/\//, '')); };
+				rows.appendChild(tr);
+			});
+		}
+
+		filter.oninput = render;
+
+		var source = new EventSource('/events');
+		source.onmessage = function (ev) {
+			events.unshift(JSON.parse(ev.data));
+			render();
+		};
+	</script>
+</body>
+</html>
+`
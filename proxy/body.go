@@ -0,0 +1,74 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+/*
+	Wraps body with the appropriate decompressor for encoding ("gzip",
+	"deflate" or "" for identity), so Directors always see plain bytes.
+*/
+func decodeBody(body io.ReadCloser, encoding string) (io.ReadCloser, error) {
+
+	switch encoding {
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return gz, nil
+	case "deflate":
+		return flate.NewReader(body), nil
+	case "":
+		return body, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported Content-Encoding: %s", encoding)
+}
+
+/*
+	Re-compresses buf with encoding, undoing decodeBody, so the bytes
+	sent to the client and saved to the archive match what was
+	advertised by the original Content-Encoding header.
+*/
+func encodeBody(buf []byte, encoding string) ([]byte, error) {
+
+	switch encoding {
+	case "gzip":
+		var out bytes.Buffer
+		wri := gzip.NewWriter(&out)
+		if _, err := wri.Write(buf); err != nil {
+			return nil, err
+		}
+		if err := wri.Close(); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	case "deflate":
+		var out bytes.Buffer
+		wri, err := flate.NewWriter(&out, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := wri.Write(buf); err != nil {
+			return nil, err
+		}
+		if err := wri.Close(); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	case "":
+		return buf, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported Content-Encoding: %s", encoding)
+}
@@ -0,0 +1,48 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestEncodeDecodeBodyRoundTrip(t *testing.T) {
+
+	want := []byte("the quick brown fox jumps over the lazy dog")
+
+	for _, encoding := range []string{"", "gzip", "deflate"} {
+
+		encoded, err := encodeBody(want, encoding)
+
+		if err != nil {
+			t.Fatalf("encodeBody(%q): %s", encoding, err)
+		}
+
+		decoded, err := decodeBody(ioutil.NopCloser(bytes.NewReader(encoded)), encoding)
+
+		if err != nil {
+			t.Fatalf("decodeBody(%q): %s", encoding, err)
+		}
+
+		got, err := ioutil.ReadAll(decoded)
+
+		if err != nil {
+			t.Fatalf("reading decoded body (%q): %s", encoding, err)
+		}
+
+		if !bytes.Equal(got, want) {
+			t.Errorf("%q round-trip: got %q, want %q", encoding, got, want)
+		}
+	}
+}
+
+func TestDecodeBodyUnsupportedEncoding(t *testing.T) {
+	if _, err := decodeBody(ioutil.NopCloser(bytes.NewReader(nil)), "br"); err == nil {
+		t.Error("expected an error for an unsupported Content-Encoding")
+	}
+}
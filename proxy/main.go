@@ -7,9 +7,13 @@ package proxy
 
 import (
 	"github.com/xiam/hyperfox/mimext"
+	"bytes"
+	"crypto/tls"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 	"os"
 	"fmt"
@@ -21,18 +25,27 @@ import (
 	Returns a io.WriteCloser that will be called
 	everytime new content is received from the destination.
 
+	Writer functions are also given the original *http.Request, so
+	that archive formats that need both sides of the exchange (such
+	as save.Transaction) don't have to recover it from res.Request.
+
 	Writer functions should not edit response headers or
 	body.
 */
-type Writer func(*http.Response) io.WriteCloser
+type Writer func(*http.Request, *http.Response) io.WriteCloser
 
 /*
-	Called before giving any output to the client.
-
-	Director functions can be used to edit response headers
-	and body before arriving to the client.
+	Called before giving any output to the client, once the body has
+	been transparently decoded (gzip/deflate) so Director functions
+	always see plain bytes.
+
+	Director functions can edit response headers directly on res. To
+	edit the body, they return a replacement io.ReadCloser that will
+	be used instead of res.Body; returning nil keeps it unchanged. The
+	replacement is re-encoded and Content-Length recomputed once all
+	directors have run.
 */
-type Director func(*http.Response) error
+type Director func(*http.Response) (io.ReadCloser, error)
 
 /*
 	Called right before sending content to the client.
@@ -42,6 +55,43 @@ type Director func(*http.Response) error
 */
 type Logger func(*http.Response) error
 
+/*
+	A compact, JSON-friendly summary of a captured transaction, pushed
+	to an EventSink from inside intercept as soon as a response has
+	been fully processed.
+*/
+type Event struct {
+	ID          uint64    `json:"id"`
+	Time        time.Time `json:"time"`
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+}
+
+/*
+	Receives a live feed of Events as transactions are captured. The
+	inspector subpackage implements this to drive its web UI.
+*/
+type EventSink interface {
+	Publish(Event)
+}
+
+/*
+	Stores a fully captured transaction: the request (and its buffered
+	body, captured before it was sent upstream), the response and its
+	post-director body, re-encoded with the response's Content-Encoding
+	so it holds the same bytes sent to the client. Storage implementations are
+	pluggable, so captures can go to the filesystem, a database or an
+	external service instead of being hard-coded to one archive format.
+	The filesystem layout used historically by save.Body and save.Head
+	is itself just the default implementation, save.FSStorage.
+*/
+type Storage interface {
+	Store(req *http.Request, reqBody []byte, res *http.Response, resBody []byte) error
+}
+
 /*
 	Storage directories.
 */
@@ -59,6 +109,25 @@ type Proxy struct {
 	Writers   []Writer
 	Directors []Director
 	Loggers   []Logger
+	Storages  []Storage
+	// CA is the root certificate used to sign the leaf certificates
+	// minted for intercepted HTTPS hosts. Required for CONNECT support.
+	CA tls.Certificate
+	// CertCache holds the leaf certificates minted for each intercepted
+	// host so they are only generated once.
+	CertCache *CertCache
+	// Router holds the reverse-proxy / vhost rules. Requests matching
+	// a registered rule are forwarded to its backend instead of being
+	// proxied transparently.
+	Router *Router
+	// Inspector, if set, receives an Event for every captured
+	// transaction. Leave nil to disable the inspector web UI.
+	Inspector EventSink
+	// InspectorBind is the address the inspector web UI should listen
+	// on, e.g. "0.0.0.0:8081". It is informational only: callers are
+	// responsible for starting the inspector themselves and assigning
+	// it to Inspector.
+	InspectorBind string
 }
 
 /*
@@ -69,6 +138,8 @@ func New() *Proxy {
 	self.Writers = []Writer{}
 	self.Directors = []Director{}
 	self.Bind = "0.0.0.0:9999"
+	self.CertCache = NewCertCache()
+	self.Router = NewRouter()
 	return self
 }
 
@@ -102,6 +173,16 @@ func (self *Proxy) AddLogger(dir Logger) {
 	self.Loggers = append(self.Loggers, dir)
 }
 
+/*
+	Adds a Storage backend to the Proxy.
+
+	Storage backends are called in the same order
+	they are added.
+*/
+func (self *Proxy) AddStorage(st Storage) {
+	self.Storages = append(self.Storages, st)
+}
+
 // http://golang.org/src/pkg/net/http/httputil/reverseproxy.go#L72
 func copyHeader(dst http.Header, src http.Header) {
 	for k, _ := range dst {
@@ -114,6 +195,30 @@ func copyHeader(dst http.Header, src http.Header) {
 	}
 }
 
+/*
+	Reads req's body into memory and replaces it with an equivalent,
+	re-readable body, so the request can still be sent upstream while
+	the original bytes are kept around for Storage backends. Returns
+	nil if req has no body.
+*/
+func bufferRequestBody(req *http.Request) []byte {
+
+	if req.Body == nil {
+		return nil
+	}
+
+	buf, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+
+	if err != nil {
+		return nil
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+
+	return buf
+}
+
 /*
 	Catches a client request and proxies it to the
 	destination server.
@@ -122,6 +227,16 @@ func copyHeader(dst http.Header, src http.Header) {
 */
 func (self *Proxy) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
 
+	if req.Method == "CONNECT" {
+		self.handleConnect(wri, req)
+		return
+	}
+
+	if route := self.Router.match(req.Host, req.URL.Path); route != nil {
+		self.serveRoute(wri, req, route)
+		return
+	}
+
 	out := new(http.Request)
 
 	transport := http.DefaultTransport
@@ -137,13 +252,15 @@ func (self *Proxy) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
 
 	out.Header.Add("Host", req.Host)
 
+	reqBody := bufferRequestBody(out)
+
 	res, err := transport.RoundTrip(out)
 
 	if err != nil {
 		panic(err)
 	}
 
-	self.intercept(wri, res)
+	self.intercept(wri, out, reqBody, res)
 }
 
 /*
@@ -215,12 +332,65 @@ func Workdir(dir string) error {
 	Catches a server response and processes it before sending it
 	to the client.
 */
-func (self *Proxy) intercept(dst http.ResponseWriter, res *http.Response) {
+func (self *Proxy) intercept(dst http.ResponseWriter, req *http.Request, reqBody []byte, res *http.Response) {
 	var i int
+	var bodySize int64
+	var body []byte
+
+	encoding := res.Header.Get("Content-Encoding")
+
+	// Directors need the whole body in memory to rewrite it, a
+	// Content-Encoding needs to be undone and redone around them, and
+	// Storage backends are only ever given the full body too. With
+	// none of those configured, the response is streamed straight
+	// through below instead of being buffered, so large downloads
+	// don't sit in memory or stall waiting for the upstream to finish.
+	//
+	// connResponseWriter is the exception: it serializes straight to a
+	// hijacked CONNECT connection, which has no surrounding HTTP/1.1
+	// keep-alive machinery to fall back on. A streamed, unbuffered
+	// chunked response would reach it with neither Content-Length nor
+	// Transfer-Encoding, leaving the client with no way to tell where
+	// the body ends. Buffering always gives it a recomputed
+	// Content-Length to forward instead.
+	_, isConnResponseWriter := dst.(*connResponseWriter)
+	needsBuffer := len(self.Directors) > 0 || encoding != "" || len(self.Storages) > 0 || isConnResponseWriter
+
+	if res.Body != nil && needsBuffer {
+
+		/* Transparently decoding so directors only ever see plain bytes. */
+		if decoded, err := decodeBody(res.Body, encoding); err == nil {
+			res.Body = decoded
+		}
 
-	/* Applying directors before copying headers. */
-	for i, _ = range self.Directors {
-		self.Directors[i](res)
+		/* Applying directors before copying headers. */
+		for i, _ = range self.Directors {
+			if newBody, err := self.Directors[i](res); err == nil && newBody != nil {
+				res.Body = newBody
+			}
+		}
+
+		/* Buffering the post-director body so Content-Length can be
+		   recomputed and so Storage backends see the same bytes that
+		   are sent to the client. */
+		buf, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		if err == nil {
+			if encoded, err := encodeBody(buf, encoding); err == nil {
+				buf = encoded
+			}
+			body = buf
+			res.Header.Set("Content-Length", strconv.Itoa(len(buf)))
+			res.Body = ioutil.NopCloser(bytes.NewReader(buf))
+		}
+	}
+
+	/* Handing the transaction to every configured Storage backend. */
+	for i, _ := range self.Storages {
+		if err := self.Storages[i].Store(req, reqBody, res, body); err != nil {
+			log.Printf("Storage: %s\n", err)
+		}
 	}
 
 	/* Copying headers. */
@@ -233,7 +403,7 @@ func (self *Proxy) intercept(dst http.ResponseWriter, res *http.Response) {
 
 	/* Handling requests. */
 	for i, _ := range self.Writers {
-		wcloser := self.Writers[i](res)
+		wcloser := self.Writers[i](req, res)
 		if wcloser != nil {
 			wclosers = append(wclosers, wcloser)
 		}
@@ -250,7 +420,20 @@ func (self *Proxy) intercept(dst http.ResponseWriter, res *http.Response) {
 		for i, _ := range wclosers {
 			writers = append(writers, wclosers[i])
 		}
-		io.Copy(io.MultiWriter(writers...), res.Body)
+		n, _ := io.Copy(io.MultiWriter(writers...), res.Body)
+		bodySize = n
+	}
+
+	/* Notifying the inspector, if any, of the captured transaction. */
+	if self.Inspector != nil {
+		self.Inspector.Publish(Event{
+			Time:        time.Now(),
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			Status:      res.StatusCode,
+			ContentType: res.Header.Get("Content-Type"),
+			Size:        bodySize,
+		})
 	}
 
 	/* Closing */
@@ -0,0 +1,224 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+	A single reverse-proxy rule: requests to Domain whose path starts
+	with Location are forwarded to Backend.
+*/
+type Route struct {
+	Domain      string `json:"domain"`
+	Location    string `json:"location"`
+	Backend     string `json:"backend"`
+	RewriteHost bool   `json:"rewrite_host"`
+
+	backend *url.URL
+}
+
+/*
+	Router matches incoming requests by Host header and longest-prefix
+	path and forwards them to the registered backend, mirroring the
+	vhost-mux approach used by reverse proxies like frp.
+*/
+type Router struct {
+	mu     sync.RWMutex
+	routes map[string][]*Route
+}
+
+/*
+	Returns a new, empty Router.
+*/
+func NewRouter() *Router {
+	return &Router{
+		routes: make(map[string][]*Route),
+	}
+}
+
+/*
+	Registers a new rule: requests whose Host header matches domain and
+	whose path starts with location are forwarded to backendURL. If
+	rewriteHost is true the outgoing request's Host header is set to
+	the backend's host instead of being preserved.
+*/
+func (self *Router) Register(domain, location, backendURL string, rewriteHost bool) error {
+
+	backend, err := url.Parse(backendURL)
+
+	if err != nil {
+		return err
+	}
+
+	route := &Route{
+		Domain:      domain,
+		Location:    location,
+		Backend:     backendURL,
+		RewriteHost: rewriteHost,
+		backend:     backend,
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.routes[domain] = append(self.routes[domain], route)
+
+	sort.Slice(self.routes[domain], func(i, j int) bool {
+		return len(self.routes[domain][i].Location) > len(self.routes[domain][j].Location)
+	})
+
+	return nil
+}
+
+/*
+	Removes the rule registered for domain and location, if any.
+*/
+func (self *Router) Unregister(domain, location string) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	routes := self.routes[domain]
+
+	for i := range routes {
+		if routes[i].Location == location {
+			self.routes[domain] = append(routes[:i], routes[i+1:]...)
+			return
+		}
+	}
+}
+
+/*
+	Returns the longest-prefix route registered for host and reqPath,
+	or nil if none matches.
+*/
+func (self *Router) match(host, reqPath string) *Route {
+
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	for _, route := range self.routes[host] {
+		if strings.HasPrefix(reqPath, route.Location) {
+			return route
+		}
+	}
+
+	return nil
+}
+
+/*
+	Loads a list of routes from a JSON configuration file and registers
+	each of them, e.g.:
+
+		[
+			{"domain": "example.com", "location": "/api", "backend": "http://backend:8080", "rewrite_host": true}
+		]
+*/
+func (self *Router) LoadFile(file string) error {
+
+	fp, err := os.Open(file)
+
+	if err != nil {
+		return err
+	}
+
+	defer fp.Close()
+
+	routes := []Route{}
+
+	if err := json.NewDecoder(fp).Decode(&routes); err != nil {
+		return err
+	}
+
+	for _, route := range routes {
+		if err := self.Register(route.Domain, route.Location, route.Backend, route.RewriteHost); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+	Builds the outgoing request for a matched route: joins the
+	backend's scheme/host/path with the request's path, preserves the
+	query, appends to X-Forwarded-For and optionally rewrites the Host
+	header.
+*/
+func (self *Route) buildRequest(req *http.Request) *http.Request {
+
+	out := new(http.Request)
+	*out = *req
+
+	out.Proto = "HTTP/1.1"
+	out.ProtoMajor = 1
+	out.ProtoMinor = 1
+	out.Close = false
+
+	out.URL.Scheme = self.backend.Scheme
+	out.URL.Host = self.backend.Host
+	out.URL.Path = singleJoiningSlash(self.backend.Path, strings.TrimPrefix(req.URL.Path, self.Location))
+
+	if self.RewriteHost {
+		out.Host = self.backend.Host
+	}
+
+	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		if prior := out.Header.Get("X-Forwarded-For"); prior != "" {
+			clientIP = prior + ", " + clientIP
+		}
+		out.Header.Set("X-Forwarded-For", clientIP)
+	}
+
+	return out
+}
+
+// http://golang.org/src/pkg/net/http/httputil/reverseproxy.go
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+/*
+	Forwards req to route's backend and runs the response through the
+	regular Writer/Director/Logger pipeline so archiving works
+	uniformly for both the transparent proxy and the reverse-proxy
+	modes.
+
+	Should not be called directly.
+*/
+func (self *Proxy) serveRoute(wri http.ResponseWriter, req *http.Request, route *Route) {
+
+	out := route.buildRequest(req)
+
+	transport := http.DefaultTransport
+
+	reqBody := bufferRequestBody(out)
+
+	res, err := transport.RoundTrip(out)
+
+	if err != nil {
+		panic(err)
+	}
+
+	self.intercept(wri, out, reqBody, res)
+}
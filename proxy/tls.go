@@ -0,0 +1,342 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package proxy
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+	Default validity periods for the root CA and the leaf certificates
+	minted on the fly for each intercepted host.
+*/
+const (
+	caValidFor   = 10 * 365 * 24 * time.Hour
+	leafValidFor = 365 * 24 * time.Hour
+)
+
+/*
+	Caches leaf certificates signed for each SNI hostname so that
+	repeated CONNECT requests to the same host reuse the same
+	certificate instead of minting a new one every time.
+*/
+type CertCache struct {
+	mu    sync.Mutex
+	certs map[string]*tls.Certificate
+}
+
+/*
+	Returns a new, empty CertCache.
+*/
+func NewCertCache() *CertCache {
+	return &CertCache{
+		certs: make(map[string]*tls.Certificate),
+	}
+}
+
+/*
+	Returns a leaf certificate for the given host, signed by ca,
+	generating and caching one on first use.
+*/
+func (self *CertCache) leafFor(host string, ca tls.Certificate) (*tls.Certificate, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if cert, ok := self.certs[host]; ok {
+		return cert, nil
+	}
+
+	cert, err := signLeaf(host, ca)
+	if err != nil {
+		return nil, err
+	}
+
+	self.certs[host] = cert
+
+	return cert, nil
+}
+
+/*
+	Generates a self-signed root CA certificate and private key suitable
+	for signing leaf certificates on the fly.
+*/
+func GenerateCA(commonName string) (tls.Certificate, error) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{"Hyperfox"},
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidFor),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        template,
+	}, nil
+}
+
+/*
+	Signs a new leaf certificate for host using ca.
+*/
+func signLeaf(host string, ca tls.Certificate) (*tls.Certificate, error) {
+
+	caCert := ca.Leaf
+
+	if caCert == nil {
+		var err error
+		caCert, err = x509.ParseCertificate(ca.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: host,
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(leafValidFor),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, ca.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.Certificate[0]},
+		PrivateKey:  key,
+		Leaf:        template,
+	}, nil
+}
+
+/*
+	Writes cert to certOut and its private key to keyOut, both in PEM
+	format, so the root CA can be imported and trusted by a browser.
+*/
+func ExportCA(cert tls.Certificate, certOut, keyOut io.Writer) error {
+
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}); err != nil {
+		return err
+	}
+
+	key, ok := cert.PrivateKey.(*rsa.PrivateKey)
+
+	if !ok {
+		return fmt.Errorf("Unsupported private key type.")
+	}
+
+	return pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+/*
+	http.ResponseWriter that serializes directly to a hijacked
+	connection, used to feed decrypted HTTPS responses through the
+	regular intercept pipeline.
+*/
+type connResponseWriter struct {
+	conn   io.Writer
+	header http.Header
+	wrote  bool
+}
+
+func (self *connResponseWriter) Header() http.Header {
+	return self.header
+}
+
+func (self *connResponseWriter) WriteHeader(status int) {
+	if self.wrote {
+		return
+	}
+	self.wrote = true
+	fmt.Fprintf(self.conn, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	self.header.Write(self.conn)
+	fmt.Fprint(self.conn, "\r\n")
+}
+
+func (self *connResponseWriter) Write(p []byte) (int, error) {
+	if !self.wrote {
+		self.WriteHeader(http.StatusOK)
+	}
+	return self.conn.Write(p)
+}
+
+/*
+	Handles a CONNECT request: hijacks the client connection, terminates
+	TLS with a leaf certificate minted for the requested host and feeds
+	the decrypted requests back through the Writer/Director/Logger
+	pipeline.
+
+	Should not be called directly.
+*/
+func (self *Proxy) handleConnect(wri http.ResponseWriter, req *http.Request) {
+
+	if len(self.CA.Certificate) == 0 {
+		http.Error(wri, "CONNECT is not supported: no CA certificate configured.", http.StatusInternalServerError)
+		return
+	}
+
+	hij, ok := wri.(http.Hijacker)
+
+	if !ok {
+		http.Error(wri, "Hijacking is not supported.", http.StatusInternalServerError)
+		return
+	}
+
+	conn, _, err := hij.Hijack()
+
+	if err != nil {
+		log.Printf("Hijack: %s\n", err)
+		return
+	}
+
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		return
+	}
+
+	host := req.URL.Host
+
+	if host == "" {
+		host = req.Host
+	}
+
+	config := &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name, _, _ = net.SplitHostPort(host)
+			}
+			return self.CertCache.leafFor(name, self.CA)
+		},
+	}
+
+	tlsConn := tls.Server(conn, config)
+
+	defer tlsConn.Close()
+
+	if err := tlsConn.Handshake(); err != nil {
+		log.Printf("Handshake: %s\n", err)
+		return
+	}
+
+	buf := bufio.NewReader(tlsConn)
+
+	for {
+		creq, err := http.ReadRequest(buf)
+
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("ReadRequest: %s\n", err)
+			}
+			return
+		}
+
+		creq.URL.Scheme = "https"
+		creq.URL.Host = host
+		creq.RemoteAddr = req.RemoteAddr
+
+		self.serveTLS(&connResponseWriter{conn: tlsConn, header: make(http.Header)}, creq)
+
+		if creq.Close {
+			return
+		}
+	}
+}
+
+/*
+	Dials the upstream host over TLS and replays the decrypted request,
+	feeding the response through the regular intercept pipeline.
+
+	Should not be called directly.
+*/
+func (self *Proxy) serveTLS(dst http.ResponseWriter, req *http.Request) {
+
+	out := new(http.Request)
+
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+
+	*out = *req
+	out.Proto = "HTTP/1.1"
+	out.ProtoMajor = 1
+	out.ProtoMinor = 1
+	out.Close = false
+
+	out.URL.Scheme = "https"
+	out.URL.Host = req.Host
+
+	out.Header.Add("Host", req.Host)
+
+	reqBody := bufferRequestBody(out)
+
+	res, err := transport.RoundTrip(out)
+
+	if err != nil {
+		log.Printf("RoundTrip: %s\n", err)
+		return
+	}
+
+	self.intercept(dst, out, reqBody, res)
+}
@@ -0,0 +1,49 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package main
+
+import (
+	"github.com/xiam/hyperfox/proxy"
+	"log"
+	"os"
+)
+
+/*
+	Generates a root CA certificate and private key and writes them to
+	hyperfox-ca.pem and hyperfox-ca.key, so they can be loaded by the
+	proxy and the certificate imported into a browser's trust store.
+*/
+func main() {
+
+	cert, err := proxy.GenerateCA("Hyperfox Root CA")
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	certOut, err := os.Create("hyperfox-ca.pem")
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer certOut.Close()
+
+	keyOut, err := os.Create("hyperfox-ca.key")
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer keyOut.Close()
+
+	if err := proxy.ExportCA(cert, certOut, keyOut); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Wrote hyperfox-ca.pem and hyperfox-ca.key.\n")
+	log.Printf("Import hyperfox-ca.pem into your browser as a trusted root authority.\n")
+}
@@ -0,0 +1,71 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package jsonl
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+	One line of the JSON-lines stream produced by Storage.
+*/
+type record struct {
+	Time        time.Time   `json:"time"`
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	Status      int         `json:"status"`
+	Headers     http.Header `json:"headers"`
+	RequestBody string      `json:"request_body"`
+	Body        string      `json:"body"`
+}
+
+/*
+	Storage backend that writes one JSON object per captured
+	transaction to Out, one per line, so captures can be piped into jq
+	or similar tools. Implements proxy.Storage.
+*/
+type Storage struct {
+	Out io.Writer
+	// mu serializes writes to Out: intercept runs one goroutine per
+	// connection and calls Store concurrently, and unlike the sqlite
+	// and s3 backends, a plain io.Writer has no concurrency guarantees
+	// of its own, so interleaved writes would corrupt the line-per-record
+	// framing the jq pipe depends on.
+	mu sync.Mutex
+}
+
+/*
+	Returns a new Storage writing to stdout.
+*/
+func New() *Storage {
+	return &Storage{Out: os.Stdout}
+}
+
+/*
+	Store implements proxy.Storage.
+*/
+func (self *Storage) Store(req *http.Request, reqBody []byte, res *http.Response, resBody []byte) error {
+
+	rec := record{
+		Time:        time.Now(),
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Status:      res.StatusCode,
+		Headers:     res.Header,
+		RequestBody: string(reqBody),
+		Body:        string(resBody),
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return json.NewEncoder(self.Out).Encode(rec)
+}
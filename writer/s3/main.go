@@ -0,0 +1,74 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+/*
+	Storage backend that ships the response body of each captured
+	transaction to an S3 (or any other PUT-compatible) object store,
+	keyed by host, path and timestamp. Only the response body and its
+	Content-Type are sent; the request and the other response headers
+	are not. Implements proxy.Storage.
+*/
+type Storage struct {
+	// Endpoint is the base URL objects are PUT under, e.g.
+	// "https://my-bucket.s3.amazonaws.com/hyperfox".
+	Endpoint string
+	Client   *http.Client
+}
+
+/*
+	Returns a new Storage that PUTs each transaction's response body
+	under endpoint.
+*/
+func New(endpoint string) *Storage {
+	return &Storage{
+		Endpoint: endpoint,
+		Client:   http.DefaultClient,
+	}
+}
+
+/*
+	Store implements proxy.Storage.
+*/
+func (self *Storage) Store(req *http.Request, reqBody []byte, res *http.Response, resBody []byte) error {
+
+	key := fmt.Sprintf("%s/%s%s-%d", self.Endpoint, req.URL.Host, req.URL.Path, time.Now().UnixNano())
+
+	out, err := http.NewRequest("PUT", key, bytes.NewReader(resBody))
+
+	if err != nil {
+		return err
+	}
+
+	out.Header.Set("Content-Type", res.Header.Get("Content-Type"))
+
+	client := self.Client
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(out)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("PUT %s: %s", key, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package save
+
+import (
+	"github.com/xiam/hyperfox/proxy"
+	"net/http"
+	"os"
+	"path"
+)
+
+/*
+	FSStorage is the default proxy.Storage backend: it archives each
+	transaction to the filesystem using the same archive/host/path
+	layout historically produced by Body and Head.
+*/
+type FSStorage struct{}
+
+/*
+	Store implements proxy.Storage.
+*/
+func (FSStorage) Store(req *http.Request, reqBody []byte, res *http.Response, resBody []byte) error {
+
+	file := proxy.ArchiveFile(res)
+
+	if err := proxy.Workdir(path.Dir(file)); err != nil {
+		return err
+	}
+
+	fp, err := os.Create(file)
+
+	if err != nil {
+		return err
+	}
+
+	defer fp.Close()
+
+	if _, err := fp.Write(resBody); err != nil {
+		return err
+	}
+
+	head, err := os.Create(file + ".head")
+
+	if err != nil {
+		return err
+	}
+
+	defer head.Close()
+
+	return res.Header.Write(head)
+}
@@ -13,7 +13,7 @@ import (
 	"os"
 )
 
-func Body(res *http.Response) io.WriteCloser {
+func Body(req *http.Request, res *http.Response) io.WriteCloser {
 
 	file := proxy.ArchiveFile(res)
 
@@ -24,7 +24,7 @@ func Body(res *http.Response) io.WriteCloser {
 	return fp
 }
 
-func Head(res *http.Response) io.WriteCloser {
+func Head(req *http.Request, res *http.Response) io.WriteCloser {
 
 	file := proxy.ArchiveFile(res) + ".head"
 
@@ -0,0 +1,200 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package save
+
+import (
+	"github.com/xiam/hyperfox/proxy"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strconv"
+	"time"
+)
+
+/*
+	Directory, relative to proxy.ArchiveDir, where full request/response
+	transactions are stored.
+*/
+var TransactionDir = "transactions"
+
+func transactionName(t time.Time) string {
+	return fmt.Sprintf(
+		"%04d%02d%02d-%02d%02d%02d-%09d.txn",
+		t.Year(),
+		t.Month(),
+		t.Day(),
+		t.Hour(),
+		t.Minute(),
+		t.Second(),
+		t.Nanosecond(),
+	)
+}
+
+/*
+	Transaction archives req and res as a single file holding the raw
+	HTTP/1.1 request followed by the raw response, the same wire format
+	produced by httputil.DumpRequestOut and httputil.DumpResponse, so
+	the archive is directly consumable by curl, httputil.ReadRequest
+	and other standard HTTP tooling.
+
+	The returned io.WriteCloser still expects the response body to be
+	written to it, appending it right after the response headers.
+
+	Also appends the transaction's file name to a per-host index file.
+*/
+func Transaction(req *http.Request, res *http.Response) io.WriteCloser {
+
+	host := res.Request.URL.Host
+
+	dir := proxy.ArchiveDir + proxy.PS + TransactionDir + proxy.PS + host
+
+	proxy.Workdir(dir)
+
+	name := transactionName(time.Now().Local())
+
+	fp, err := os.Create(dir + proxy.PS + name)
+
+	if err != nil {
+		return nil
+	}
+
+	if reqDump, err := httputil.DumpRequestOut(req, true); err == nil {
+		fp.Write(reqDump)
+	}
+
+	return &txnWriter{fp: fp, res: res, dir: dir, name: name}
+}
+
+/*
+	Buffers the response body written to it so that, once Close is
+	called and the final size is known, the framing of a copy of res
+	can be corrected before the response headers are dumped: res
+	arrives from the Transport with whatever TransferEncoding/
+	ContentLength the upstream server used (often "chunked" / -1), but
+	reading res.Body already yields de-chunked bytes, which is what
+	intercept appends here, so dumping those fields as-is would leave a
+	header block that claims a framing the archived bytes no longer
+	have. res itself is left unchanged.
+*/
+type txnWriter struct {
+	fp   *os.File
+	res  *http.Response
+	dir  string
+	name string
+	body bytes.Buffer
+}
+
+func (self *txnWriter) Write(p []byte) (int, error) {
+	return self.body.Write(p)
+}
+
+func (self *txnWriter) Close() error {
+	defer self.fp.Close()
+
+	res := *self.res
+	res.Header = self.res.Header.Clone()
+	res.TransferEncoding = nil
+	res.ContentLength = int64(self.body.Len())
+	res.Header.Set("Content-Length", strconv.Itoa(self.body.Len()))
+
+	if resDump, err := httputil.DumpResponse(&res, false); err == nil {
+		self.fp.Write(resDump)
+	}
+
+	if _, err := self.fp.Write(self.body.Bytes()); err != nil {
+		return err
+	}
+
+	indexTransaction(self.dir, self.name)
+
+	return nil
+}
+
+/*
+	Appends name to the host's index file, one entry per line, so tools
+	can iterate over all transactions without walking the directory.
+*/
+func indexTransaction(dir, name string) {
+
+	index, err := os.OpenFile(dir+proxy.PS+"index", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return
+	}
+
+	defer index.Close()
+
+	fmt.Fprintln(index, name)
+}
+
+/*
+	Transactions reads the index file for host and returns the raw
+	request and response for each archived transaction, in the order
+	they were recorded.
+*/
+func Transactions(host string) ([]*http.Request, []*http.Response, error) {
+
+	dir := proxy.ArchiveDir + proxy.PS + TransactionDir + proxy.PS + host
+
+	index, err := os.Open(dir + proxy.PS + "index")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer index.Close()
+
+	reqs := []*http.Request{}
+	ress := []*http.Response{}
+
+	scanner := bufio.NewScanner(index)
+
+	for scanner.Scan() {
+
+		fp, err := os.Open(dir + proxy.PS + scanner.Text())
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		buf := bufio.NewReader(fp)
+
+		req, err := http.ReadRequest(buf)
+
+		if err != nil {
+			fp.Close()
+			return nil, nil, err
+		}
+
+		res, err := http.ReadResponse(buf, req)
+
+		if err != nil {
+			fp.Close()
+			return nil, nil, err
+		}
+
+		/* Reading the body before closing the file it is read from. */
+		body, err := ioutil.ReadAll(res.Body)
+
+		fp.Close()
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		reqs = append(reqs, req)
+		ress = append(ress, res)
+	}
+
+	return reqs, ress, scanner.Err()
+}
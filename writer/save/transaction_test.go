@@ -0,0 +1,92 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package save
+
+import (
+	"github.com/xiam/hyperfox/proxy"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTransactionRoundTrip(t *testing.T) {
+
+	oldArchiveDir := proxy.ArchiveDir
+	proxy.ArchiveDir = t.TempDir()
+	defer func() { proxy.ArchiveDir = oldArchiveDir }()
+
+	req, err := http.NewRequest("GET", "http://example.com/foo", nil)
+
+	if err != nil {
+		t.Fatalf("NewRequest: %s", err)
+	}
+
+	body := "hello, world"
+
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+		// Mimics a chunked upstream response whose body, as read from
+		// res.Body and handed to Transaction, is already de-chunked:
+		// TransferEncoding/ContentLength must not be
+		// dumped as-is, or the archived header would claim a framing
+		// the appended bytes no longer have.
+		TransferEncoding: []string{"chunked"},
+		ContentLength:    -1,
+	}
+
+	wri := Transaction(req, res)
+
+	if wri == nil {
+		t.Fatal("Transaction returned a nil writer")
+	}
+
+	if _, err := wri.Write([]byte(body)); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+
+	if err := wri.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	reqs, ress, err := Transactions(req.URL.Host)
+
+	if err != nil {
+		t.Fatalf("Transactions: %s", err)
+	}
+
+	if len(reqs) != 1 || len(ress) != 1 {
+		t.Fatalf("expected 1 archived transaction, got %d requests and %d responses", len(reqs), len(ress))
+	}
+
+	if reqs[0].URL.Path != "/foo" {
+		t.Errorf("expected request path /foo, got %s", reqs[0].URL.Path)
+	}
+
+	if ress[0].StatusCode != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, ress[0].StatusCode)
+	}
+
+	if ct := ress[0].Header.Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("expected Content-Type text/plain, got %q", ct)
+	}
+
+	got, err := ioutil.ReadAll(ress[0].Body)
+
+	if err != nil {
+		t.Fatalf("reading archived response body: %s", err)
+	}
+
+	if string(got) != body {
+		t.Errorf("expected archived body %q, got %q", body, got)
+	}
+}
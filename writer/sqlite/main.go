@@ -0,0 +1,87 @@
+/*
+	Written by José Carlos Nieto <xiam@menteslibres.org>
+	License MIT
+*/
+
+package sqlite
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"database/sql"
+	"net/http"
+	"net/http/httputil"
+	"time"
+)
+
+/*
+	Storage backend that records each transaction as a row in a SQLite
+	database, enabling SQL queries over captured traffic. Implements
+	proxy.Storage.
+*/
+type Storage struct {
+	db *sql.DB
+}
+
+/*
+	Opens (creating if needed) the SQLite database at file and ensures
+	the transactions table exists.
+*/
+func New(file string) (*Storage, error) {
+
+	db, err := sql.Open("sqlite3", file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS transactions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ts INTEGER,
+			method TEXT,
+			url TEXT,
+			status INTEGER,
+			req_headers TEXT,
+			req_body BLOB,
+			resp_headers TEXT,
+			resp_body BLOB
+		)
+	`)
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Storage{db: db}, nil
+}
+
+/*
+	Store implements proxy.Storage.
+*/
+func (self *Storage) Store(req *http.Request, reqBody []byte, res *http.Response, resBody []byte) error {
+
+	reqHeaders, _ := httputil.DumpRequestOut(req, false)
+	resHeaders, _ := httputil.DumpResponse(res, false)
+
+	_, err := self.db.Exec(
+		`INSERT INTO transactions (ts, method, url, status, req_headers, req_body, resp_headers, resp_body) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		time.Now().Unix(),
+		req.Method,
+		req.URL.String(),
+		res.StatusCode,
+		string(reqHeaders),
+		reqBody,
+		string(resHeaders),
+		resBody,
+	)
+
+	return err
+}
+
+/*
+	Closes the underlying database handle.
+*/
+func (self *Storage) Close() error {
+	return self.db.Close()
+}